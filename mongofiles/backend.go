@@ -0,0 +1,70 @@
+package mongofiles
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// FileInfo is a store-agnostic description of a single stored file, as
+// returned by Backend.List. Fields that a given backend can't populate
+// (e.g. a content hash, for a backend that doesn't track one) are left zero.
+type FileInfo struct {
+	Name        string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+	Hash        string
+}
+
+// Backend is the storage-agnostic interface that the list/get/put/delete/search
+// verbs operate against. GridFS is the original and default implementation;
+// fs and s3 let the same verbs work against a local directory or an
+// S3-compatible bucket. The mirror command does not go through a Backend: it
+// always syncs a local directory into GridFS.
+type Backend interface {
+	// List returns every file whose name starts with prefix.
+	List(prefix string) ([]FileInfo, error)
+	// Open returns a reader for the named file's contents.
+	Open(name string) (io.ReadCloser, error)
+	// Create returns a writer that stores its contents under name. Closing
+	// the writer finalizes the file; backends that verify content hashes
+	// (e.g. GridFS) surface a mismatch as an error from Close.
+	Create(name, contentType string) (io.WriteCloser, error)
+	// Remove deletes the named file. Removing a name that doesn't exist is
+	// not an error, to match GridFS's own idempotent Remove.
+	Remove(name string) error
+}
+
+// HashVerifier is implemented by backends whose List results populate
+// FileInfo.Hash, meaning they can back the get --verify flag. fs and s3
+// don't record a hash today, so --verify against them is rejected up front
+// instead of always failing against an empty recorded hash.
+type HashVerifier interface {
+	Backend
+	SupportsVerify() bool
+}
+
+// selectBackend constructs the Backend named by --backend. gfs is only used
+// by the gridfs backend; mount, mirror, and http keep operating on it directly,
+// since those commands are inherently GridFS-specific.
+func (self *MongoFiles) selectBackend(gfs *mgo.GridFS) (Backend, error) {
+	switch self.StorageOptions.Backend {
+	case "", "gridfs":
+		return &GridFSBackend{gfs: gfs, hashAlgo: self.StorageOptions.HashAlgo}, nil
+	case "fs":
+		if self.StorageOptions.BackendRoot == "" {
+			return nil, fmt.Errorf("--backend-root is required for the fs backend")
+		}
+		return &FSBackend{root: self.StorageOptions.BackendRoot}, nil
+	case "s3":
+		if self.StorageOptions.BackendRoot == "" {
+			return nil, fmt.Errorf("--backend-root is required for the s3 backend")
+		}
+		return newS3Backend(self.StorageOptions.BackendRoot)
+	default:
+		return nil, fmt.Errorf("'%v' is not a valid --backend: must be gridfs, fs, or s3", self.StorageOptions.Backend)
+	}
+}
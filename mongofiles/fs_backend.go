@@ -0,0 +1,79 @@
+package mongofiles
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FSBackend stores files as plain files under a local directory, so
+// `mongofiles --backend fs --backend-root /some/dir` can stand in for a
+// GridFS bucket for the list/get/put/delete/search verbs. The mirror command
+// does not use it.
+type FSBackend struct {
+	root string
+}
+
+func (b *FSBackend) resolve(name string) string {
+	return filepath.Join(b.root, filepath.FromSlash(name))
+}
+
+func (b *FSBackend) List(prefix string) ([]FileInfo, error) {
+	var infos []FileInfo
+	err := filepath.Walk(b.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(b.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if prefix != "" && !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		infos = append(infos, FileInfo{
+			Name:    name,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing '%v': %v", b.root, err)
+	}
+	return infos, nil
+}
+
+func (b *FSBackend) Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(b.resolve(name))
+	if err != nil {
+		return nil, fmt.Errorf("error opening '%v': %v", name, err)
+	}
+	return f, nil
+}
+
+func (b *FSBackend) Create(name, contentType string) (io.WriteCloser, error) {
+	path := b.resolve(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory for '%v': %v", name, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating '%v': %v", name, err)
+	}
+	return f, nil
+}
+
+func (b *FSBackend) Remove(name string) error {
+	err := os.Remove(b.resolve(name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing '%v': %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package mongofiles
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GridFSBackend is the original Backend implementation, storing files in a
+// mgo.GridFS bucket. It owns the content-hash verification that used to live
+// directly in handlePut/handleGet: every write is md5-streamed and checked
+// against the md5 GridFS itself computes, and hashAlgo (if not "md5") is
+// additionally computed and stored under metadata.hashes.
+type GridFSBackend struct {
+	gfs      *mgo.GridFS
+	hashAlgo string
+}
+
+// SupportsVerify reports that GridFSBackend.List populates FileInfo.Hash, so
+// get --verify can compare against it.
+func (b *GridFSBackend) SupportsVerify() bool {
+	return true
+}
+
+func (b *GridFSBackend) List(prefix string) ([]FileInfo, error) {
+	query := bson.M{}
+	if prefix != "" {
+		query = bson.M{"filename": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}
+	}
+
+	cursor := b.gfs.Find(query).Iter()
+	defer cursor.Close()
+
+	var infos []FileInfo
+	var file GFSFile
+	for cursor.Next(&file) {
+		infos = append(infos, FileInfo{
+			Name:        file.Name,
+			Size:        file.Length,
+			ModTime:     file.UploadDate,
+			ContentType: file.ContentType,
+			Hash:        fileHash(file, b.hashAlgo),
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	return infos, nil
+}
+
+func (b *GridFSBackend) Open(name string) (io.ReadCloser, error) {
+	gFile, err := b.gfs.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening GridFS file '%s': %v", name, err)
+	}
+	return gFile, nil
+}
+
+func (b *GridFSBackend) Create(name, contentType string) (io.WriteCloser, error) {
+	gFile, err := b.gfs.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating '%v' in GridFS: %v", name, err)
+	}
+	if contentType != "" {
+		gFile.SetContentType(contentType)
+	}
+
+	w := &gridFSWriter{gfs: b.gfs, gFile: gFile, name: name, md5Hasher: md5.New()}
+	if b.hashAlgo != "" && b.hashAlgo != "md5" {
+		w.extraAlgo = b.hashAlgo
+		w.extraHasher, err = newHasher(b.hashAlgo)
+		if err != nil {
+			gFile.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (b *GridFSBackend) Remove(name string) error {
+	if err := b.gfs.Remove(name); err != nil {
+		return fmt.Errorf("error while removing '%v' from GridFS: %v", name, err)
+	}
+	return nil
+}
+
+// gridFSWriter streams into a *mgo.GridFile while hashing what passes
+// through it, so Close can verify against the server-computed md5 and,
+// for a configured non-md5 algorithm, persist the extra digest.
+type gridFSWriter struct {
+	gfs         *mgo.GridFS
+	gFile       *mgo.GridFile
+	name        string
+	md5Hasher   hash.Hash
+	extraAlgo   string
+	extraHasher hash.Hash
+}
+
+func (w *gridFSWriter) Write(p []byte) (int, error) {
+	w.md5Hasher.Write(p)
+	if w.extraHasher != nil {
+		w.extraHasher.Write(p)
+	}
+	return w.gFile.Write(p)
+}
+
+func (w *gridFSWriter) Close() error {
+	if err := w.gFile.Close(); err != nil {
+		return fmt.Errorf("error while finalizing '%v' in GridFS: %v", w.name, err)
+	}
+
+	computedMd5 := hex.EncodeToString(w.md5Hasher.Sum(nil))
+	if computedMd5 != w.gFile.MD5() {
+		return fmt.Errorf("content hash mismatch for '%v': computed md5 %v but GridFS recorded %v (possible corruption in transit)",
+			w.name, computedMd5, w.gFile.MD5())
+	}
+
+	if w.extraHasher != nil {
+		digest := hex.EncodeToString(w.extraHasher.Sum(nil))
+		err := w.gfs.Files.UpdateId(w.gFile.Id(), bson.M{"$set": bson.M{"metadata.hashes." + w.extraAlgo: digest}})
+		if err != nil {
+			return fmt.Errorf("error storing %v hash for '%v': %v", w.extraAlgo, w.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package mongofiles
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// newHasher returns a hash.Hash for one of the algorithms accepted by the
+// --hash flag. GridFS only computes md5 itself, so any other algorithm's
+// digest has to be computed here and stored in the files-collection
+// metadata document instead.
+func newHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case "", "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "blake2b":
+		return blake2b.New256(nil)
+	default:
+		return nil, fmt.Errorf("unsupported --hash algorithm '%v': must be md5, sha1, sha256, or blake2b", algo)
+	}
+}
+
+// fileHash returns the digest to display for a file's --hash algorithm: the
+// built-in md5 field for "md5" (or when unset), otherwise whatever was
+// recorded under metadata.hashes by a previous 'put --hash'.
+func fileHash(file GFSFile, algo string) string {
+	if algo == "" || algo == "md5" {
+		return file.Md5
+	}
+	if hashes, ok := file.Metadata["hashes"].(bson.M); ok {
+		if digest, ok := hashes[algo].(string); ok {
+			return digest
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package mongofiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// gfsHandler serves a single GridFS bucket read-only over HTTP: "GET /" lists
+// its contents as JSON, and "GET /<filename>" (or HEAD) streams a file,
+// honoring If-None-Match and Range the way a static file server would.
+type gfsHandler struct {
+	gfs *mgo.GridFS
+}
+
+func (h *gfsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" {
+		h.serveListing(w, r)
+		return
+	}
+
+	var file GFSFile
+	if err := h.gfs.Find(bson.M{"filename": name}).One(&file); err != nil {
+		if err == mgo.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := `"` + file.Md5 + `"`
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && inm == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Length, 10))
+		return
+	}
+
+	gFile, err := h.gfs.OpenId(file.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer gFile.Close()
+
+	offset, length, status, err := parseRange(r.Header.Get("Range"), file.Length)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	if status == http.StatusPartialContent {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, file.Length))
+		if _, err := gFile.Seek(offset, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+	io.CopyN(w, gFile, length)
+}
+
+// parseRange parses a single-range "Range: bytes=a-b" header, returning the
+// offset and length to serve along with the status (200 or 206) to send.
+func parseRange(rangeHeader string, total int64) (offset, length int64, status int, err error) {
+	if rangeHeader == "" {
+		return 0, total, http.StatusOK, nil
+	}
+
+	spec := strings.TrimPrefix(rangeHeader, "bytes=")
+	if spec == rangeHeader {
+		return 0, 0, 0, fmt.Errorf("unsupported range unit")
+	}
+
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, 0, fmt.Errorf("malformed range '%v'", rangeHeader)
+	}
+
+	if parts[0] == "" {
+		// suffix range: "-N" means the last N bytes
+		suffix, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if suffix > total {
+			suffix = total
+		}
+		return total - suffix, suffix, http.StatusPartialContent, nil
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	end := total - 1
+	if parts[1] != "" {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	if start > end || start >= total {
+		return 0, 0, 0, fmt.Errorf("range '%v' out of bounds for length %d", rangeHeader, total)
+	}
+	if end >= total {
+		end = total - 1
+	}
+	return start, end - start + 1, http.StatusPartialContent, nil
+}
+
+// serveListing handles "GET /", returning a JSON array describing every file
+// in the bucket.
+func (h *gfsHandler) serveListing(w http.ResponseWriter, r *http.Request) {
+	cursor := h.gfs.Find(nil).Iter()
+	defer cursor.Close()
+
+	files := []GFSFile{}
+	var file GFSFile
+	for cursor.Next(&file) {
+		files = append(files, file)
+	}
+	if err := cursor.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// handleHTTP starts a read-only HTTP server exposing the configured GridFS
+// bucket at addr, blocking until the server exits or an error occurs.
+func (self *MongoFiles) handleHTTP(gfs *mgo.GridFS, addr string) error {
+	log.Logf(log.Always, "serving GridFS bucket '%v.%v' over HTTP on '%v'\n", self.StorageOptions.DB,
+		self.StorageOptions.GridFSPrefix, addr)
+
+	return http.ListenAndServe(addr, &gfsHandler{gfs: gfs})
+}
@@ -0,0 +1,230 @@
+package mongofiles
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+)
+
+// mirrorTask describes a single local file that needs to be put into GridFS,
+// either because it is new or because it differs from the existing entry.
+type mirrorTask struct {
+	localPath  string
+	gridFSName string
+}
+
+// handleMirror recursively walks localDir and reconciles it with the
+// configured GridFS prefix, similar in spirit to `rclone sync`: files are
+// only re-put when their size or content md5 differs, and --delete removes
+// GridFS entries that no longer exist locally.
+func (self *MongoFiles) handleMirror(gfs *mgo.GridFS, localDir string) (string, error) {
+	existing, err := mirrorListGridFS(gfs)
+	if err != nil {
+		return "", err
+	}
+
+	var tasks []mirrorTask
+	seen := make(map[string]bool)
+	var skipped, unchanged int
+
+	err = filepath.Walk(localDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		seen[name] = true
+
+		if gfsFile, ok := existing[name]; ok {
+			same, err := mirrorUnchanged(p, info, gfsFile)
+			if err != nil {
+				return err
+			}
+			if same {
+				unchanged++
+				return nil
+			}
+		}
+
+		tasks = append(tasks, mirrorTask{localPath: p, gridFSName: name})
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error walking '%v': %v", localDir, err)
+	}
+
+	var toDelete []string
+	if self.StorageOptions.Delete {
+		for name := range existing {
+			if !seen[name] {
+				toDelete = append(toDelete, name)
+			}
+		}
+	}
+
+	if self.StorageOptions.DryRun {
+		plan := fmt.Sprintf("%d unchanged, %d to put, %d to delete:\n", unchanged, len(tasks), len(toDelete))
+		for _, t := range tasks {
+			plan += fmt.Sprintf("  put    %v\n", t.gridFSName)
+		}
+		for _, name := range toDelete {
+			plan += fmt.Sprintf("  delete %v\n", name)
+		}
+		return plan, nil
+	}
+
+	if err := self.mirrorPutAll(tasks); err != nil {
+		return "", err
+	}
+	skipped = unchanged
+
+	for _, name := range toDelete {
+		if err := gfs.Remove(name); err != nil {
+			return "", fmt.Errorf("error removing '%v' from GridFS: %v", name, err)
+		}
+	}
+
+	return fmt.Sprintf("mirrored '%v': put %d, skipped %d unchanged, deleted %d\n",
+		localDir, len(tasks), skipped, len(toDelete)), nil
+}
+
+// mirrorPutAll puts every task's local file into GridFS using a pool of
+// --parallel workers, each with its own mgo session copied from
+// SessionProvider so concurrent puts don't contend on a single socket.
+func (self *MongoFiles) mirrorPutAll(tasks []mirrorTask) error {
+	parallel := self.StorageOptions.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	taskCh := make(chan mirrorTask)
+	errCh := make(chan error, parallel)
+	stopCh := make(chan struct{})
+	var stopOnce sync.Once
+	var wg sync.WaitGroup
+
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			session, err := self.SessionProvider.GetSession()
+			if err != nil {
+				errCh <- err
+				stopOnce.Do(func() { close(stopCh) })
+				return
+			}
+			defer session.Close()
+			workerGfs := session.DB(self.StorageOptions.DB).GridFS(self.StorageOptions.GridFSPrefix)
+
+			for t := range taskCh {
+				if err := mirrorPutOne(workerGfs, t); err != nil {
+					errCh <- err
+					stopOnce.Do(func() { close(stopCh) })
+					return
+				}
+				log.Logf(log.DebugLow, "mirrored '%v' to GridFS file '%v'", t.localPath, t.gridFSName)
+			}
+		}()
+	}
+
+	// feed the workers from a separate goroutine: if a worker has already died
+	// on error and stopCh is closed, this select keeps the send from blocking
+	// forever instead of deadlocking the command.
+	go func() {
+		defer close(taskCh)
+		for _, t := range tasks {
+			select {
+			case taskCh <- t:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errCh)
+
+	if err, ok := <-errCh; ok {
+		return err
+	}
+	return nil
+}
+
+func mirrorPutOne(gfs *mgo.GridFS, t mirrorTask) error {
+	localFile, err := os.Open(t.localPath)
+	if err != nil {
+		return fmt.Errorf("error while opening local file '%v': %v", t.localPath, err)
+	}
+	defer localFile.Close()
+
+	// drop any existing entry with this name first, so a changed file replaces
+	// it in place rather than GridFS accumulating duplicate same-named files
+	if err := gfs.Remove(t.gridFSName); err != nil {
+		return fmt.Errorf("error removing previous '%v' from GridFS: %v", t.gridFSName, err)
+	}
+
+	gFile, err := gfs.Create(t.gridFSName)
+	if err != nil {
+		return fmt.Errorf("error while creating '%v' in GridFS: %v", t.gridFSName, err)
+	}
+	defer gFile.Close()
+
+	if _, err := io.Copy(gFile, localFile); err != nil {
+		return fmt.Errorf("error while storing '%v' into GridFS: %v", t.localPath, err)
+	}
+	return nil
+}
+
+// mirrorUnchanged reports whether a local file already matches the GridFS
+// entry, comparing size first (cheap) and only hashing the file when sizes agree.
+func mirrorUnchanged(localPath string, info os.FileInfo, gfsFile GFSFile) (bool, error) {
+	if info.Size() != gfsFile.Length {
+		return false, nil
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false, fmt.Errorf("error while opening local file '%v': %v", localPath, err)
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, fmt.Errorf("error hashing local file '%v': %v", localPath, err)
+	}
+
+	return strings.EqualFold(hex.EncodeToString(h.Sum(nil)), gfsFile.Md5), nil
+}
+
+// mirrorListGridFS returns every file currently stored under the bucket's
+// prefix, keyed by filename, so the walk above can diff against it in memory.
+func mirrorListGridFS(gfs *mgo.GridFS) (map[string]GFSFile, error) {
+	cursor := gfs.Find(nil).Iter()
+	defer cursor.Close()
+
+	existing := make(map[string]GFSFile)
+	var file GFSFile
+	for cursor.Next(&file) {
+		existing[file.Name] = file
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error listing GridFS files: %v", err)
+	}
+	return existing, nil
+}
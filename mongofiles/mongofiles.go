@@ -1,13 +1,14 @@
 package mongofiles
 
 import (
+	"encoding/hex"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
-	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"hash"
 	"io"
 	"os"
 	"regexp"
@@ -21,6 +22,9 @@ const (
 	Put    = "put"
 	Get    = "get"
 	Delete = "delete"
+	Mount  = "mount"
+	Mirror = "mirror"
+	HTTP   = "http"
 )
 
 type MongoFiles struct {
@@ -48,6 +52,7 @@ type GFSFile struct {
 	Md5         string        `bson:"md5"`
 	UploadDate  time.Time     `bson:"uploadDate"`
 	ContentType string        `bson:"contentType,omitempty"`
+	Metadata    bson.M        `bson:"metadata,omitempty"`
 }
 
 func (mf *MongoFiles) ValidateCommand(args []string) error {
@@ -74,6 +79,25 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 			return fmt.Errorf("'%v' argument missing", args[0])
 		}
 		fileName = args[1]
+	case Mount:
+		// the supporting argument here is the local mountpoint, not a GridFS filename
+		if len(args) == 1 || args[1] == "" {
+			return fmt.Errorf("'%v' argument missing", args[0])
+		}
+		fileName = args[1]
+	case Mirror:
+		// mirror takes its local directory from --local rather than a positional argument
+		if len(args) > 1 {
+			return fmt.Errorf("too many positional arguments")
+		}
+		if mf.StorageOptions.LocalFileName == "" {
+			return fmt.Errorf("--local is required for 'mirror'")
+		}
+	case HTTP:
+		// http takes its listen address from --addr rather than a positional argument
+		if len(args) > 1 {
+			return fmt.Errorf("too many positional arguments")
+		}
 	default:
 		return fmt.Errorf("'%v' is not a valid command", args[0])
 	}
@@ -88,22 +112,62 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 	return nil
 }
 
-// query GridFS for files and display the results
-func (self *MongoFiles) findAndDisplay(gfs *mgo.GridFS, query bson.M) (string, error) {
-	display := ""
+// runBackendCommand dispatches the five store-agnostic verbs -
+// list/search/get/put/delete - against whichever Backend --backend selected.
+func (self *MongoFiles) runBackendCommand(backend Backend) (string, error) {
+	switch self.Command {
+	case List:
+		infos, err := backend.List(self.FileName)
+		if err != nil {
+			return "", err
+		}
+		return self.displayFileInfos(infos), nil
 
-	cursor := gfs.Find(query).Iter()
-	defer cursor.Close()
+	case Search:
+		infos, err := backend.List("")
+		if err != nil {
+			return "", err
+		}
+		re, err := regexp.Compile(self.FileName)
+		if err != nil {
+			return "", fmt.Errorf("invalid search pattern '%v': %v", self.FileName, err)
+		}
+		var matches []FileInfo
+		for _, info := range infos {
+			if re.MatchString(info.Name) {
+				matches = append(matches, info)
+			}
+		}
+		return self.displayFileInfos(matches), nil
 
-	var file GFSFile
-	for cursor.Next(&file) {
-		display += fmt.Sprintf("%s\t%d\n", file.Name, file.Length)
-	}
-	if err := cursor.Err(); err != nil {
-		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	case Get:
+		return self.handleGet(backend)
+
+	case Put:
+		return self.handlePut(backend)
+
+	case Delete:
+		if err := backend.Remove(self.FileName); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("successfully deleted all instances of '%v'\n", self.FileName), nil
 	}
 
-	return display, nil
+	return "", fmt.Errorf("'%v' is not a backend command", self.Command)
+}
+
+// displayFileInfos renders a backend's listing as "name\tsize" per file,
+// with an optional trailing hash column.
+func (self *MongoFiles) displayFileInfos(infos []FileInfo) string {
+	display := ""
+	for _, info := range infos {
+		if self.StorageOptions.ShowHash {
+			display += fmt.Sprintf("%s\t%d\t%s\n", info.Name, info.Size, info.Hash)
+		} else {
+			display += fmt.Sprintf("%s\t%d\n", info.Name, info.Size)
+		}
+	}
+	return display
 }
 
 // Return local file (set by --local optional flag) name (or default to self.FileName)
@@ -115,69 +179,138 @@ func (self *MongoFiles) getLocalFileName() string {
 	return localFileName
 }
 
+// usingStdout returns true if the current command streams file data through
+// os.Stdout, meaning any other log output must be routed to stderr instead.
+func (self *MongoFiles) usingStdout() bool {
+	return self.Command == Get && self.getLocalFileName() == "-"
+}
+
 // handle logic for 'get' command
-func (self *MongoFiles) handleGet(gfs *mgo.GridFS) (string, error) {
-	gFile, err := gfs.Open(self.FileName)
+func (self *MongoFiles) handleGet(backend Backend) (string, error) {
+	if self.StorageOptions.Verify {
+		hv, ok := backend.(HashVerifier)
+		if !ok || !hv.SupportsVerify() {
+			return "", fmt.Errorf("--verify is not supported for --backend '%v': it does not record content hashes",
+				self.StorageOptions.Backend)
+		}
+	}
+
+	reader, err := backend.Open(self.FileName)
 	if err != nil {
-		return "", fmt.Errorf("error opening GridFS file '%s': %v", self.FileName, err)
+		return "", err
 	}
-	defer gFile.Close()
+	defer reader.Close()
 
 	localFileName := self.getLocalFileName()
-	localFile, err := os.Create(localFileName)
-	if err != nil {
-		return "", fmt.Errorf("error while opening local file '%v': %v\n", localFileName, err)
+
+	var localFile io.Writer
+	if localFileName == "-" {
+		localFile = os.Stdout
+	} else {
+		f, err := os.Create(localFileName)
+		if err != nil {
+			return "", fmt.Errorf("error while opening local file '%v': %v\n", localFileName, err)
+		}
+		defer f.Close()
+		log.Logf(log.DebugLow, "created local file '%v'", localFileName)
+		localFile = f
 	}
-	defer localFile.Close()
-	log.Logf(log.DebugLow, "created local file '%v'", localFileName)
 
-	_, err = io.Copy(localFile, gFile)
+	writer := localFile
+	var verifyHasher hash.Hash
+	if self.StorageOptions.Verify {
+		verifyHasher, err = newHasher(self.StorageOptions.HashAlgo)
+		if err != nil {
+			return "", err
+		}
+		writer = io.MultiWriter(localFile, verifyHasher)
+	}
+
+	_, err = io.Copy(writer, reader)
 	if err != nil {
 		return "", fmt.Errorf("error while writing data into local file '%v': %v\n", localFileName, err)
 	}
 
+	if self.StorageOptions.Verify {
+		computed := hex.EncodeToString(verifyHasher.Sum(nil))
+		recorded, err := self.recordedHash(backend, self.FileName)
+		if err != nil {
+			return "", err
+		}
+		if recorded == "" || computed != recorded {
+			return "", fmt.Errorf("verify failed for '%v': computed %v hash %v but store recorded %v",
+				self.FileName, self.StorageOptions.HashAlgo, computed, recorded)
+		}
+	}
+
+	// when streaming to stdout, this status line must not be mixed into the
+	// piped file data, so it goes to stderr instead of being returned for
+	// the caller to print to stdout
+	if localFileName == "-" {
+		fmt.Fprintf(os.Stderr, "Finished writing to: %s\n", localFileName)
+		return "", nil
+	}
+
 	return fmt.Sprintf("Finished writing to: %s\n", localFileName), nil
 }
 
+// recordedHash looks up the hash a backend's List recorded for name, for
+// comparison against a freshly computed one in handleGet's --verify path.
+func (self *MongoFiles) recordedHash(backend Backend, name string) (string, error) {
+	infos, err := backend.List(name)
+	if err != nil {
+		return "", err
+	}
+	for _, info := range infos {
+		if info.Name == name {
+			return info.Hash, nil
+		}
+	}
+	return "", nil
+}
+
 // handle logic for 'put' command
-func (self *MongoFiles) handlePut(gfs *mgo.GridFS) (string, error) {
+func (self *MongoFiles) handlePut(backend Backend) (string, error) {
 	localFileName := self.getLocalFileName()
 
 	var output string
 
 	// check if --replace flag turned on
 	if self.StorageOptions.Replace {
-		err := gfs.Remove(self.FileName)
-		if err != nil {
+		if err := backend.Remove(self.FileName); err != nil {
 			return "", err
 		}
-		output = fmt.Sprintf("removed all instances of '%v' from GridFS\n", self.FileName)
+		output = fmt.Sprintf("removed all instances of '%v' from the backend\n", self.FileName)
 	}
 
-	localFile, err := os.Open(localFileName)
-	if err != nil {
-		return "", fmt.Errorf("error while opening local file '%v' : %v\n", localFileName, err)
+	var localFile io.Reader
+	if localFileName == "-" {
+		localFile = os.Stdin
+	} else {
+		f, err := os.Open(localFileName)
+		if err != nil {
+			return "", fmt.Errorf("error while opening local file '%v' : %v\n", localFileName, err)
+		}
+		defer f.Close()
+		localFile = f
 	}
-	defer localFile.Close()
-	log.Logf(log.DebugLow, "creating GridFS file '%v' from local file '%v'", self.FileName, localFileName)
+	log.Logf(log.DebugLow, "storing '%v' from local file '%v'", self.FileName, localFileName)
 
-	gFile, err := gfs.Create(self.FileName)
+	writer, err := backend.Create(self.FileName, self.StorageOptions.ContentType)
 	if err != nil {
-		return "", fmt.Errorf("error while creating '%v' in GridFS: %v\n", self.FileName, err)
+		return "", err
 	}
-	defer gFile.Close()
 
-	// set optional mime type
-	if self.StorageOptions.ContentType != "" {
-		gFile.SetContentType(self.StorageOptions.ContentType)
+	if _, err := io.Copy(writer, localFile); err != nil {
+		writer.Close()
+		return "", fmt.Errorf("error while storing '%v': %v\n", localFileName, err)
 	}
 
-	_, err = io.Copy(gFile, localFile)
-	if err != nil {
-		return "", fmt.Errorf("error while storing '%v' into GridFS: %v\n", localFileName, err)
+	if err := writer.Close(); err != nil {
+		return "", err
 	}
 
-	output += fmt.Sprintf("added file: %v\n", gFile.Name())
+	output += fmt.Sprintf("added file: %v\n", self.FileName)
 	return output, nil
 }
 
@@ -215,7 +348,13 @@ func (self *MongoFiles) Run(displayConnUrl bool) (string, error) {
 	session.SetSocketTimeout(0)
 
 	if displayConnUrl {
-		log.Logf(log.Always, "connected to: %v\n", connUrl)
+		// when stdout is being used for file data (e.g. a "get ... --local -" pipeline),
+		// this must go to stderr instead so it doesn't corrupt the piped output
+		if self.usingStdout() {
+			fmt.Fprintf(os.Stderr, "connected to: %v\n", connUrl)
+		} else {
+			log.Logf(log.Always, "connected to: %v\n", connUrl)
+		}
 	}
 
 	// first validate the namespaces we'll be using: <db>.<prefix>.files and <db>.<prefix>.chunks
@@ -226,7 +365,8 @@ func (self *MongoFiles) Run(displayConnUrl bool) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	// get GridFS handle
+	// get GridFS handle; this also backs mount, mirror, and http, which are
+	// inherently GridFS-specific and so bypass the Backend abstraction below
 	gfs := session.DB(self.StorageOptions.DB).GridFS(self.StorageOptions.GridFSPrefix)
 
 	var output string
@@ -235,50 +375,38 @@ func (self *MongoFiles) Run(displayConnUrl bool) (string, error) {
 
 	switch self.Command {
 
-	case List:
+	case List, Search, Get, Put, Delete:
 
-		query := bson.M{}
-		if self.FileName != "" {
-			regex := bson.M{"$regex": "^" + regexp.QuoteMeta(self.FileName)}
-			query = bson.M{"filename": regex}
-		}
-
-		output, err = self.findAndDisplay(gfs, query)
+		backend, err := self.selectBackend(gfs)
 		if err != nil {
 			return "", err
 		}
-
-	case Search:
-
-		regex := bson.M{"$regex": self.FileName}
-		query := bson.M{"filename": regex}
-
-		output, err = self.findAndDisplay(gfs, query)
+		output, err = self.runBackendCommand(backend)
 		if err != nil {
 			return "", err
 		}
 
-	case Get:
+	case Mount:
 
-		output, err = self.handleGet(gfs)
+		err = self.handleMount(gfs, self.FileName)
 		if err != nil {
 			return "", err
 		}
+		output = fmt.Sprintf("unmounted '%v'\n", self.FileName)
 
-	case Put:
+	case Mirror:
 
-		output, err = self.handlePut(gfs)
+		output, err = self.handleMirror(gfs, self.StorageOptions.LocalFileName)
 		if err != nil {
 			return "", err
 		}
 
-	case Delete:
+	case HTTP:
 
-		err = gfs.Remove(self.FileName)
+		err = self.handleHTTP(gfs, self.StorageOptions.Addr)
 		if err != nil {
-			return "", fmt.Errorf("error while removing '%v' from GridFS: %v\n", self.FileName, err)
+			return "", err
 		}
-		output = fmt.Sprintf("successfully deleted all instances of '%v' from GridFS\n", self.FileName)
 
 	}
 
@@ -0,0 +1,235 @@
+package mongofiles
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// gridFS wraps the mgo.GridFS bucket being mounted and is shared by every
+// node (directory or file) in the synthesized directory tree.
+type gridFS struct {
+	gfs *mgo.GridFS
+}
+
+// Root implements fs.FS, returning the synthesized root directory.
+func (g *gridFS) Root() (fs.Node, error) {
+	return &gfsDir{gridFS: g, path: ""}, nil
+}
+
+// gfsDir represents a directory synthesized from the "/" separators in
+// GridFS filenames below path. GridFS has no native notion of directories,
+// so membership is derived by querying the files collection on demand.
+type gfsDir struct {
+	*gridFS
+	path string
+}
+
+func (d *gfsDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	return nil
+}
+
+// childPrefix returns the "dir/" prefix used to match entries under this directory.
+func (d *gfsDir) childPrefix() string {
+	if d.path == "" {
+		return ""
+	}
+	return d.path + "/"
+}
+
+func (d *gfsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	prefix := d.childPrefix() + name
+	query := bson.M{"filename": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix) + "(/|$)"}}
+
+	var file GFSFile
+	if err := d.gfs.Find(query).One(&file); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, fuse.ENOENT
+		}
+		return nil, err
+	}
+
+	if file.Name == prefix {
+		return &gfsFile{gridFS: d.gridFS, file: file}, nil
+	}
+	return &gfsDir{gridFS: d.gridFS, path: prefix}, nil
+}
+
+// Create implements fs.NodeCreater, letting new files be written through the
+// mount. Any existing entry with the same name is dropped first so the new
+// write replaces it instead of GridFS accumulating a duplicate.
+func (d *gfsDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	name := d.childPrefix() + req.Name
+
+	if err := d.gfs.Remove(name); err != nil {
+		return nil, nil, err
+	}
+	gFile, err := d.gfs.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f := &gfsFile{gridFS: d.gridFS, file: GFSFile{Name: name}, wfid: gFile}
+	return f, f, nil
+}
+
+func (d *gfsDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	prefix := d.childPrefix()
+	query := bson.M{"filename": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}
+
+	cursor := d.gfs.Find(query).Select(bson.M{"filename": 1}).Iter()
+	defer cursor.Close()
+
+	seen := map[string]bool{}
+	var entries []fuse.Dirent
+	var file GFSFile
+	for cursor.Next(&file) {
+		rest := strings.TrimPrefix(file.Name, prefix)
+		name := rest
+		typ := fuse.DT_File
+		if idx := strings.Index(rest, "/"); idx >= 0 {
+			name = rest[:idx]
+			typ = fuse.DT_Dir
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		entries = append(entries, fuse.Dirent{Name: name, Type: typ})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// gfsFile represents a single GridFS file's metadata, as synthesized into a
+// FUSE node. Reads and writes stream directly through the underlying
+// mgo.GridFile rather than buffering the whole file in memory.
+type gfsFile struct {
+	*gridFS
+	file GFSFile
+
+	mu   sync.Mutex
+	wfid *mgo.GridFile
+}
+
+func (f *gfsFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Size = uint64(f.file.Length)
+	a.Mtime = f.file.UploadDate
+	return nil
+}
+
+// Open implements fs.NodeOpener. Opening for write replaces the file: GridFS
+// files are write-once, so an existing entry is removed and recreated rather
+// than mutated in place, same as Create does for a brand new name.
+func (f *gfsFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if err := f.gfs.Remove(f.file.Name); err != nil {
+			return nil, err
+		}
+		gFile, err := f.gfs.Create(f.file.Name)
+		if err != nil {
+			return nil, err
+		}
+		f.wfid = gFile
+	}
+	return f, nil
+}
+
+// Read serves the requested offset and size of the file by seeking the
+// underlying GridFile, so large files are never buffered whole in memory.
+func (f *gfsFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	gFile, err := f.gfs.OpenId(f.file.Id)
+	if err != nil {
+		return err
+	}
+	defer gFile.Close()
+
+	if _, err := gFile.Seek(req.Offset, os.SEEK_SET); err != nil {
+		return err
+	}
+
+	buf := make([]byte, req.Size)
+	n, err := gFile.Read(buf)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	resp.Data = buf[:n]
+	return nil
+}
+
+// Write appends to the upload that Create or a write-mode Open already set
+// up, and is finalized when Release is called by the kernel.
+func (f *gfsFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.wfid == nil {
+		return fuse.Errno(fuse.EIO)
+	}
+
+	n, err := f.wfid.Write(req.Data)
+	if err != nil {
+		return err
+	}
+	resp.Size = n
+	return nil
+}
+
+func (f *gfsFile) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.wfid == nil {
+		return nil
+	}
+	err := f.wfid.Close()
+	f.wfid = nil
+	return err
+}
+
+// Remove unlinks a file node from its parent directory, mapping straight to
+// gfs.Remove so deletion through the mount behaves like "mongofiles delete".
+func (d *gfsDir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if req.Dir {
+		return fuse.Errno(fuse.ENOTSUP)
+	}
+	return d.gfs.Remove(d.childPrefix() + req.Name)
+}
+
+// handleMount mounts the configured GridFS bucket at mountpoint as a POSIX
+// filesystem and blocks, serving requests, until it is unmounted.
+func (self *MongoFiles) handleMount(gfs *mgo.GridFS, mountpoint string) error {
+	c, err := fuse.Mount(mountpoint, fuse.FSName("mongofiles"), fuse.Subtype("gridfs"))
+	if err != nil {
+		return fmt.Errorf("error mounting '%v': %v", mountpoint, err)
+	}
+	defer c.Close()
+
+	log.Logf(log.Always, "mounted GridFS bucket '%v.%v' at '%v'\n", self.StorageOptions.DB,
+		self.StorageOptions.GridFSPrefix, mountpoint)
+
+	if err := fs.Serve(c, &gridFS{gfs: gfs}); err != nil {
+		return fmt.Errorf("error serving mount '%v': %v", mountpoint, err)
+	}
+
+	<-c.Ready
+	return c.MountError
+}
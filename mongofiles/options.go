@@ -0,0 +1,52 @@
+package mongofiles
+
+// StorageOptions defines the set of options to use in storing/retrieving data from server.
+type StorageOptions struct {
+	// Name of the database to use
+	DB string `short:"d" long:"db" value-name:"<database-name>" description:"database to use"`
+
+	// Local filename for put|get, or local directory for mirror
+	LocalFileName string `short:"l" long:"local" value-name:"<filename>" description:"local filename for put|get"`
+
+	// Write Concern options
+	WriteConcern string `long:"writeConcern" value-name:"<write-concern>" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'" default:"majority"`
+
+	ContentType string `short:"t" long:"type" value-name:"<content-type>" description:"content/MIME type for put (default is to omit)"`
+
+	Replace bool `short:"r" long:"replace" description:"remove other files with same name before put"`
+
+	GridFSPrefix string `long:"prefix" value-name:"<prefix>" description:"GridFS prefix to use" default:"fs"`
+
+	// Delete removes GridFS entries that are no longer present locally when mirroring
+	Delete bool `long:"delete" description:"delete GridFS files with no corresponding local file (mirror only)"`
+
+	// DryRun prints the mirror plan instead of executing it
+	DryRun bool `long:"dry-run" description:"print the mirror plan without changing anything (mirror only)"`
+
+	// Parallel controls how many concurrent mgo sessions the mirror command uses to put files
+	Parallel int `long:"parallel" value-name:"<n>" description:"number of files to put in parallel (mirror only)" default:"1"`
+
+	// Addr is the address the 'http' command listens on
+	Addr string `long:"addr" value-name:"<host:port>" description:"address to listen on for the 'http' command" default:"127.0.0.1:8765"`
+
+	// HashAlgo selects the algorithm used to verify put/get content, beyond GridFS's built-in md5
+	HashAlgo string `long:"hash" value-name:"<algorithm>" description:"hash algorithm to verify content with: md5, sha1, sha256, or blake2b" default:"md5"`
+
+	// Verify re-hashes downloaded content and fails on mismatch
+	Verify bool `long:"verify" description:"re-hash downloaded content and fail if it doesn't match the recorded hash (get only)"`
+
+	// ShowHash includes a hash column in list/search output
+	ShowHash bool `long:"hashes" description:"include a hash column in list/search output"`
+
+	// Backend selects which store list/get/put/delete/search operate against
+	Backend string `long:"backend" value-name:"<name>" description:"backend to use: gridfs (default), fs, or s3" default:"gridfs"`
+
+	// BackendRoot is the root location for the fs or s3 backend: a local directory for
+	// fs, or a "bucket" or "bucket/prefix" for s3. Unused by the gridfs backend.
+	BackendRoot string `long:"backend-root" value-name:"<path>" description:"root location for the fs or s3 backend (local directory, or S3 bucket[/prefix])"`
+}
+
+// Name returns a human-readable name for the storage options group.
+func (_ *StorageOptions) Name() string {
+	return "storage"
+}
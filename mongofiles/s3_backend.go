@@ -0,0 +1,139 @@
+package mongofiles
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Backend stores files as objects in an S3-compatible bucket, under an
+// optional key prefix, so `mongofiles --backend s3 --backend-root
+// bucket/prefix` runs the list/get/put/delete/search verbs against S3. The
+// mirror command does not use it.
+type S3Backend struct {
+	svc      *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	prefix   string
+}
+
+// newS3Backend parses a "bucket" or "bucket/prefix" target, using the
+// standard AWS SDK credential chain (env vars, shared config, instance role).
+func newS3Backend(target string) (*S3Backend, error) {
+	bucket := target
+	prefix := ""
+	if idx := strings.IndexByte(target, '/'); idx >= 0 {
+		bucket, prefix = target[:idx], target[idx+1:]
+	}
+
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %v", err)
+	}
+
+	return &S3Backend{
+		svc:      s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+		bucket:   bucket,
+		prefix:   prefix,
+	}, nil
+}
+
+func (b *S3Backend) key(name string) string {
+	if b.prefix == "" {
+		return name
+	}
+	return b.prefix + "/" + name
+}
+
+func (b *S3Backend) List(prefix string) ([]FileInfo, error) {
+	var infos []FileInfo
+	err := b.svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(b.key(prefix)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			name := *obj.Key
+			if b.prefix != "" {
+				name = strings.TrimPrefix(name, b.prefix+"/")
+			}
+			infos = append(infos, FileInfo{
+				Name:    name,
+				Size:    *obj.Size,
+				ModTime: *obj.LastModified,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects in 's3://%v/%v': %v", b.bucket, b.prefix, err)
+	}
+	return infos, nil
+}
+
+func (b *S3Backend) Open(name string) (io.ReadCloser, error) {
+	out, err := b.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error opening 's3://%v/%v': %v", b.bucket, b.key(name), err)
+	}
+	return out.Body, nil
+}
+
+func (b *S3Backend) Create(name, contentType string) (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+		Body:   pr,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	uploadErr := make(chan error, 1)
+	go func() {
+		_, err := b.uploader.Upload(input)
+		pr.CloseWithError(err)
+		uploadErr <- err
+	}()
+
+	return &s3Writer{pw: pw, uploadErr: uploadErr}, nil
+}
+
+func (b *S3Backend) Remove(name string) error {
+	_, err := b.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	if err != nil {
+		return fmt.Errorf("error removing 's3://%v/%v': %v", b.bucket, b.key(name), err)
+	}
+	return nil
+}
+
+// s3Writer adapts s3manager's upload-from-a-reader API to the io.WriteCloser
+// the Backend interface expects, by writing into a pipe that the upload
+// goroutine reads from concurrently.
+type s3Writer struct {
+	pw        *io.PipeWriter
+	uploadErr chan error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	if err := w.pw.Close(); err != nil {
+		return err
+	}
+	return <-w.uploadErr
+}